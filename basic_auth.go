@@ -1,15 +1,36 @@
 package middleware
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 type basicAuth struct {
 	h    http.Handler
 	opts AuthOptions
+
+	// userHash and passHash are the SHA-256 digests of opts.User and
+	// opts.Password, precomputed once in BasicAuth() so that validate can
+	// compare credentials in constant time on every request.
+	userHash [sha256.Size]byte
+	passHash [sha256.Size]byte
+
+	// failureStore is non-nil when opts.MaxFailuresPerIP > 0, and holds
+	// either opts.FailureStore or a default in-memory store created by
+	// BasicAuth().
+	failureStore FailureStore
+
+	// trustedProxies is opts.TrustedProxies, pre-parsed once by BasicAuth().
+	trustedProxies trustedProxies
 }
 
 // AuthOptions stores the configuration for HTTP Basic Authentication.
@@ -21,7 +42,48 @@ type AuthOptions struct {
 	User                string
 	Password            string
 	UnauthorizedHandler http.Handler
-	// Advanced users can supply a custom user:password comparison function
+	// Charset, if set to "UTF-8", advertises RFC 7617 UTF-8 support in the
+	// WWW-Authenticate header and causes decoded credentials to be
+	// NFC-normalized before comparison. Credentials that are not valid
+	// UTF-8 are rejected outright.
+	Charset string
+	// SecretProvider, when set, is consulted for each authentication attempt
+	// instead of comparing against the single User/Password pair above. It
+	// is looked up by username and Realm, and should return the stored
+	// secret for that user ("" if unknown). See HtpasswdFileProvider and
+	// MapProvider for built-in implementations. When Charset is "UTF-8", the
+	// username and password passed in are NFC-normalized, but the secret
+	// SecretProvider returns is compared as-is: store it pre-normalized if it
+	// may contain non-ASCII characters.
+	SecretProvider SecretProvider
+	// Logger, when set, is notified of every authentication attempt:
+	// successful logins, failed attempts, and malformed Authorization
+	// headers. Useful for audit logs or fail2ban-style tooling.
+	Logger AuthLogger
+	// MaxFailuresPerIP, LockoutDuration and FailureWindow enable brute-force
+	// throttling: once a client IP accumulates MaxFailuresPerIP failed
+	// attempts within FailureWindow, it is locked out for LockoutDuration
+	// and served 429 Too Many Requests. Throttling is disabled when
+	// MaxFailuresPerIP is 0; when it's set but FailureWindow/LockoutDuration
+	// are left at zero, BasicAuth defaults them to one minute and fifteen
+	// minutes respectively rather than silently leaving throttling a no-op.
+	MaxFailuresPerIP int
+	LockoutDuration  time.Duration
+	FailureWindow    time.Duration
+	// TrustedProxies lists the IPs/CIDRs of proxies allowed to set
+	// X-Forwarded-For; when the direct peer matches, the first
+	// X-Forwarded-For entry is used as the client IP for throttling instead
+	// of RemoteAddr.
+	TrustedProxies []string
+	// FailureStore tracks failed attempts per IP. If nil and
+	// MaxFailuresPerIP > 0, BasicAuth() creates a default in-memory store.
+	// Supply your own implementation (e.g. backed by Redis) to share
+	// lockout state across multiple instances, or use BasicAuthWithStore to
+	// get a handle to the default store instead.
+	FailureStore FailureStore
+	// Advanced users can supply a custom user:password comparison function.
+	// When Charset is "UTF-8", the user and password passed in are
+	// NFC-normalized; compare against pre-normalized values.
 	Validate func(string, string) bool
 }
 
@@ -30,7 +92,6 @@ func (b basicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Check if we have a user-provided error handler, else set a default
 	if b.opts.UnauthorizedHandler == nil {
 		b.opts.UnauthorizedHandler = http.HandlerFunc(defaultUnauthorizedHandler)
-		return
 	}
 
 	// Set a default user/password validation function
@@ -38,12 +99,31 @@ func (b basicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		b.opts.Validate = b.validate
 	}
 
+	var ip string
+	if b.failureStore != nil {
+		ip = clientIP(r, b.trustedProxies)
+		if locked, retryAfter := b.failureStore.Locked(ip); locked {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+	}
+
 	// Check that the provided details match
 	if b.authenticate(r) == false {
+		if b.failureStore != nil {
+			if b.failureStore.RecordFailure(ip, b.opts.FailureWindow, b.opts.MaxFailuresPerIP) {
+				b.failureStore.Lock(ip, b.opts.LockoutDuration)
+			}
+		}
 		b.requestAuth(w, r)
 		return
 	}
 
+	if b.failureStore != nil {
+		b.failureStore.ResetFailures(ip)
+	}
+
 	// Call the next handler on success.
 	b.h.ServeHTTP(w, r)
 }
@@ -57,6 +137,7 @@ func (b *basicAuth) authenticate(r *http.Request) bool {
 	// Confirm the request is sending Basic Authentication credentials.
 	auth := r.Header.Get("Authorization")
 	if !strings.HasPrefix(auth, basicScheme) {
+		b.logEvent(r, "", AuthMalformed)
 		return false
 	}
 
@@ -64,33 +145,93 @@ func (b *basicAuth) authenticate(r *http.Request) bool {
 	// The first six characters are skipped e.g. "Basic ".
 	str, err := base64.StdEncoding.DecodeString(auth[len(basicScheme):])
 	if err != nil {
+		b.logEvent(r, "", AuthMalformed)
 		return false
 	}
 
+	// RFC 7617 requires that, when the UTF-8 charset has been advertised, the
+	// decoded credentials are valid UTF-8 and are compared after NFC
+	// normalization so that equivalent but differently-composed Unicode
+	// sequences from different clients still match.
+	if b.opts.Charset == "UTF-8" {
+		if !utf8.Valid(str) {
+			b.logEvent(r, "", AuthMalformed)
+			return false
+		}
+		str = norm.NFC.Bytes(str)
+	}
+
 	// Split on the first ":" character only, with any subsequent colons assumed to be part
 	// of the password. Note that the RFC2617 standard does not place any limitations on
 	// allowable characters in the password.
 	creds := strings.SplitN(string(str), ":", 2)
+	if len(creds) != 2 {
+		b.logEvent(r, "", AuthMalformed)
+		return false
+	}
+
 	// Validate the user & password match.
-	if b.validate(creds[0], creds[1]) == true {
+	if b.checkCredentials(creds[0], creds[1]) == true {
+		b.logEvent(r, creds[0], AuthSuccess)
 		return true
 	}
 
+	b.logEvent(r, creds[0], AuthFailure)
 	return false
 }
 
+// logEvent reports an authentication event to opts.Logger, if one is configured.
+func (b *basicAuth) logEvent(r *http.Request, user string, result AuthResult) {
+	if b.opts.Logger != nil {
+		b.opts.Logger.LogAuthEvent(r, user, result)
+	}
+}
+
+// checkCredentials validates the supplied user & password. When opts.SecretProvider
+// is set it is consulted for the user's stored secret and the password is checked
+// against it with CheckSecret; otherwise opts.Validate is used (ServeHTTP defaults
+// it to validate when the caller hasn't supplied their own comparison function).
+func (b *basicAuth) checkCredentials(user, password string) bool {
+	if b.opts.SecretProvider != nil {
+		secret := b.opts.SecretProvider(user, b.opts.Realm)
+		if secret == "" {
+			return false
+		}
+		return CheckSecret(password, secret)
+	}
+
+	validate := b.opts.Validate
+	if validate == nil {
+		validate = b.validate
+	}
+	return validate(user, password)
+}
+
 // Validate that the provided user & password match.
+//
+// Both the supplied and configured credentials are compared as SHA-256
+// digests using a constant-time comparison, following the go-kit basic auth
+// approach. This keeps comparison time independent of the length of the
+// correct value, and ensures a mismatched username doesn't short-circuit
+// before the password is checked, which would otherwise leak timing
+// information about which part of the credentials was wrong.
 func (b *basicAuth) validate(user string, password string) bool {
-	if user == b.opts.User && password == b.opts.Password {
-		return true
-	}
+	userHash := sha256.Sum256([]byte(user))
+	passHash := sha256.Sum256([]byte(password))
 
-	return false
+	userMatch := subtle.ConstantTimeCompare(userHash[:], b.userHash[:]) == 1
+	passMatch := subtle.ConstantTimeCompare(passHash[:], b.passHash[:]) == 1
+
+	return userMatch && passMatch
 }
 
 // Require authentication, and serve our error handler otherwise.
 func (b *basicAuth) requestAuth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%q"`, b.opts.Realm))
+	header := fmt.Sprintf(`Basic realm="%s"`, b.opts.Realm)
+	if b.opts.Charset == "UTF-8" {
+		header += `, charset="UTF-8"`
+	}
+	w.Header().Set("WWW-Authenticate", header)
 	b.opts.UnauthorizedHandler.ServeHTTP(w, r)
 }
 
@@ -100,8 +241,9 @@ func defaultUnauthorizedHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // BasicAuth provides HTTP middleware for protecting URIs with HTTP Basic Authentication
-// as per RFC 2617. The server authenticates a user:password combination provided in the
-// "Authorization" HTTP header.
+// as per RFC 7617 (which obsoletes RFC 2617). The server authenticates a user:password
+// combination provided in the "Authorization" HTTP header. Set AuthOptions.Charset to
+// "UTF-8" to advertise and enforce RFC 7617's UTF-8 credential encoding.
 //
 // Example:
 //
@@ -128,10 +270,56 @@ func defaultUnauthorizedHandler(w http.ResponseWriter, r *http.Request) {
 // not make for a wholly secure authentication mechanism. You should serve your content over
 // HTTPS to mitigate this, noting that "Basic Authentication" is meant to be just that: basic!
 func BasicAuth(o AuthOptions) func(http.Handler) http.Handler {
+	fn, _ := BasicAuthWithStore(o)
+	return fn
+}
+
+// BasicAuthWithStore behaves exactly like BasicAuth, but also returns the
+// FailureStore the middleware ends up using: either opts.FailureStore, or
+// (when opts.MaxFailuresPerIP > 0 and opts.FailureStore is nil) the default
+// in-memory store BasicAuth would otherwise create internally with no way
+// for the caller to reach it. Use this instead of BasicAuth when you need to
+// call ResetFailures/Locked on the default store yourself, e.g. to unlock an
+// IP from an admin endpoint. Returns a nil FailureStore when MaxFailuresPerIP
+// is 0.
+func BasicAuthWithStore(o AuthOptions) (func(http.Handler) http.Handler, FailureStore) {
+	user, password := o.User, o.Password
+	if o.Charset == "UTF-8" {
+		// authenticate NFC-normalizes incoming credentials when Charset is
+		// UTF-8, so the configured secret must be normalized the same way
+		// or a client sending the far more common precomposed form would
+		// never match a secret stored in decomposed form.
+		user = norm.NFC.String(user)
+		password = norm.NFC.String(password)
+	}
+	userHash := sha256.Sum256([]byte(user))
+	passHash := sha256.Sum256([]byte(password))
+
+	var store FailureStore
+	if o.MaxFailuresPerIP > 0 {
+		// A zero FailureWindow or LockoutDuration would silently disable
+		// throttling (RecordFailure never accumulates across a zero window,
+		// and Locked never sees an active lockout), so fall back to sane
+		// defaults rather than leaving the feature a no-op.
+		if o.FailureWindow <= 0 {
+			o.FailureWindow = time.Minute
+		}
+		if o.LockoutDuration <= 0 {
+			o.LockoutDuration = 15 * time.Minute
+		}
+
+		store = o.FailureStore
+		if store == nil {
+			store = NewMemoryFailureStore(time.Minute, o.FailureWindow+o.LockoutDuration)
+		}
+	}
+
+	proxies := parseTrustedProxies(o.TrustedProxies)
+
 	fn := func(h http.Handler) http.Handler {
-		return basicAuth{h, o}
+		return basicAuth{h: h, opts: o, userHash: userHash, passHash: passHash, failureStore: store, trustedProxies: proxies}
 	}
-	return fn
+	return fn, store
 }
 
 // SimpleBasicAuth is a convenience wrapper around BasicAuth. It takes a user and password, and
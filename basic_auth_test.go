@@ -1,8 +1,9 @@
-package httpauth
+package middleware
 
 import (
 	"encoding/base64"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -14,7 +15,7 @@ func TestBasicAuthAuthenticate(t *testing.T) {
 
 	authOpts := AuthOptions{
 		Realm: "Restricted",
-		AuthFunc: func(user string, password string) bool {
+		Validate: func(user string, password string) bool {
 			return user == correctUser && password == correctPassword
 		},
 	}
@@ -47,3 +48,32 @@ func TestBasicAuthAuthenticate(t *testing.T) {
 		t.Fatal("Failed on correct credentials")
 	}
 }
+
+func TestBasicAuthUTF8NormalizesConfiguredPassword(t *testing.T) {
+	// decomposedPassword spells "cafe" with a combining acute accent after
+	// the "e" (NFD); precomposedPassword spells it with a single
+	// precomposed "é" (NFC). authenticate NFC-normalizes incoming
+	// credentials, so a configured password stored in decomposed form must
+	// also be normalized when hashed in BasicAuth, or a client sending the
+	// far more common precomposed form would never match it.
+	decomposedPassword := "café"
+	precomposedPassword := "café"
+
+	mw := BasicAuth(AuthOptions{
+		Realm:    "Restricted",
+		User:     "dave",
+		Password: decomposedPassword,
+		Charset:  "UTF-8",
+	})
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	auth := base64.StdEncoding.EncodeToString([]byte("dave:" + precomposedPassword))
+	r.Header.Set("Authorization", "Basic "+auth)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the precomposed password to match the decomposed configured one, got status %d", w.Code)
+	}
+}
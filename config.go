@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config describes the shape of a YAML or JSON configuration block used to
+// wire up BasicAuth directly from an application's existing config file,
+// mirroring the pattern used by gosuv-style server configs.
+type Config struct {
+	Enabled      bool   `yaml:"enabled" json:"enabled"`
+	Username     string `yaml:"username" json:"username"`
+	Password     string `yaml:"password" json:"password"`
+	Realm        string `yaml:"realm" json:"realm"`
+	HtpasswdFile string `yaml:"htpasswd_file" json:"htpasswd_file"`
+}
+
+// BasicAuthFromConfig builds a BasicAuth middleware from cfg. If cfg.Enabled
+// is false it returns a pass-through middleware that calls the next handler
+// unchanged, so applications can toggle auth per-environment without
+// branching at the call site. If cfg.HtpasswdFile is set it is used as the
+// credential source via HtpasswdFileProvider, taking precedence over
+// cfg.Username/cfg.Password.
+func BasicAuthFromConfig(cfg Config) func(http.Handler) http.Handler {
+	if !cfg.Enabled {
+		return func(h http.Handler) http.Handler {
+			return h
+		}
+	}
+
+	opts := AuthOptions{
+		Realm:    cfg.Realm,
+		User:     cfg.Username,
+		Password: cfg.Password,
+	}
+	if cfg.HtpasswdFile != "" {
+		opts.SecretProvider = HtpasswdFileProvider(cfg.HtpasswdFile)
+	}
+
+	return BasicAuth(opts)
+}
+
+// BasicAuthFromConfigFile reads a Config from the YAML or JSON file at path
+// and builds a BasicAuth middleware from it, per BasicAuthFromConfig.
+func BasicAuthFromConfigFile(path string) (func(http.Handler) http.Handler, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return BasicAuthFromConfig(cfg), nil
+}
+
+// LoadConfig reads and parses a Config from the file at path, selecting the
+// format by file extension: ".json" for JSON, anything else for YAML.
+func LoadConfig(path string) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var cfg Config
+	if strings.HasSuffix(path, ".json") {
+		err = json.Unmarshal(data, &cfg)
+	} else {
+		err = yaml.Unmarshal(data, &cfg)
+	}
+	if err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestBasicAuthFromConfigDisabled(t *testing.T) {
+	cfg := Config{Enabled: false}
+
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	handler := BasicAuthFromConfig(cfg)(next)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if !called {
+		t.Fatal("expected disabled config to pass requests straight through")
+	}
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	path := writeTempFile(t, "config.json", `{"enabled": true, "username": "dave", "password": "secret", "realm": "Restricted"}`)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Enabled || cfg.Username != "dave" || cfg.Password != "secret" || cfg.Realm != "Restricted" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+}
+
+func writeTempFile(t *testing.T, name, contents string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := dir + "/" + name
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+	return path
+}
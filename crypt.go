@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+
+	"github.com/GehirnInc/crypt"
+	_ "github.com/GehirnInc/crypt/apr1_crypt"
+	_ "github.com/GehirnInc/crypt/md5_crypt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// CheckSecret reports whether password is correct for secret, which may be a
+// bcrypt hash ($2a$/$2y$/$2b$), an htpasswd SHA entry ({SHA}...), an
+// MD5-crypt/apr1 hash ($apr1$/$1$), or a plain-text password.
+func CheckSecret(password, secret string) bool {
+	switch {
+	case strings.HasPrefix(secret, "$2a$"), strings.HasPrefix(secret, "$2y$"), strings.HasPrefix(secret, "$2b$"):
+		return bcrypt.CompareHashAndPassword([]byte(secret), []byte(password)) == nil
+	case strings.HasPrefix(secret, "{SHA}"):
+		return checkSHASecret(password, secret)
+	case strings.HasPrefix(secret, "$apr1$"), strings.HasPrefix(secret, "$1$"):
+		c := crypt.NewFromHash(secret)
+		return c.Verify(secret, []byte(password)) == nil
+	default:
+		return subtle.ConstantTimeCompare([]byte(password), []byte(secret)) == 1
+	}
+}
+
+// checkSHASecret verifies password against an htpasswd "{SHA}" entry, which
+// stores the base64-encoded SHA-1 digest of the plain-text password.
+func checkSHASecret(password, secret string) bool {
+	sum := sha1.Sum([]byte(password))
+	got := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(got), []byte(secret)) == 1
+}
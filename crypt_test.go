@@ -0,0 +1,23 @@
+package middleware
+
+import "testing"
+
+func TestCheckSecretPlainText(t *testing.T) {
+	if !CheckSecret("hunter2", "hunter2") {
+		t.Fatal("expected plain-text secret to match")
+	}
+	if CheckSecret("wrong", "hunter2") {
+		t.Fatal("expected plain-text secret mismatch to fail")
+	}
+}
+
+func TestCheckSecretSHA(t *testing.T) {
+	// "{SHA}" + base64(sha1("hunter2"))
+	const secret = "{SHA}87u9ZqY9S/F0eUBXjsPQEDUw4h0="
+	if !CheckSecret("hunter2", secret) {
+		t.Fatal("expected SHA secret to match")
+	}
+	if CheckSecret("wrong", secret) {
+		t.Fatal("expected SHA secret mismatch to fail")
+	}
+}
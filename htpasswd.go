@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HtpasswdFileProvider returns a SecretProvider backed by an Apache-style
+// htpasswd file at path. The file is re-parsed whenever its modification
+// time changes, so credentials can be rotated without restarting the
+// process. Entries may use bcrypt, {SHA}, or MD5-crypt/apr1 hashes, as
+// produced by the htpasswd(1) and htpasswd2 tools.
+func HtpasswdFileProvider(path string) SecretProvider {
+	h := &htpasswdFile{path: path}
+	return h.secret
+}
+
+type htpasswdFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	secrets map[string]string
+}
+
+func (h *htpasswdFile) secret(user, realm string) string {
+	h.reload()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.secrets[user]
+}
+
+// reload re-parses the htpasswd file if it has changed since it was last
+// read, or if it has never been read.
+func (h *htpasswdFile) reload() {
+	info, err := os.Stat(h.path)
+	if err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	stale := h.secrets == nil || info.ModTime().After(h.modTime)
+	h.mu.Unlock()
+	if !stale {
+		return
+	}
+
+	f, err := os.Open(h.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	secrets := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		secrets[parts[0]] = parts[1]
+	}
+
+	h.mu.Lock()
+	h.secrets = secrets
+	h.modTime = info.ModTime()
+	h.mu.Unlock()
+}
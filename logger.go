@@ -0,0 +1,40 @@
+package middleware
+
+import "net/http"
+
+// AuthResult describes the outcome of a single authentication attempt,
+// passed to AuthLogger.LogAuthEvent.
+type AuthResult int
+
+const (
+	// AuthSuccess indicates the request presented valid credentials.
+	AuthSuccess AuthResult = iota
+	// AuthFailure indicates the request presented credentials that did not match.
+	AuthFailure
+	// AuthMalformed indicates the request had no Authorization header, or one
+	// that could not be parsed as HTTP Basic credentials.
+	AuthMalformed
+)
+
+// String returns a lower-case name for the result, suitable for logging.
+func (res AuthResult) String() string {
+	switch res {
+	case AuthSuccess:
+		return "success"
+	case AuthFailure:
+		return "failure"
+	case AuthMalformed:
+		return "malformed"
+	default:
+		return "unknown"
+	}
+}
+
+// AuthLogger records the outcome of authentication attempts, following the
+// rclone LoggedBasicAuth pattern. Implementations are called with the
+// request so they can report the remote address and path, the attempted
+// username (empty for malformed headers), and the outcome, without
+// httpauth forcing a specific logging dependency on callers.
+type AuthLogger interface {
+	LogAuthEvent(r *http.Request, user string, result AuthResult)
+}
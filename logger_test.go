@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type recordingLogger struct {
+	events []AuthResult
+	users  []string
+}
+
+func (l *recordingLogger) LogAuthEvent(r *http.Request, user string, result AuthResult) {
+	l.events = append(l.events, result)
+	l.users = append(l.users, user)
+}
+
+func TestBasicAuthLogsEvents(t *testing.T) {
+	logger := &recordingLogger{}
+	b := &basicAuth{
+		opts:     AuthOptions{User: "dave", Password: "secret", Logger: logger},
+		userHash: sha256.Sum256([]byte("dave")),
+		passHash: sha256.Sum256([]byte("secret")),
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	b.authenticate(r)
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.SetBasicAuth("dave", "wrong")
+	b.authenticate(r)
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.SetBasicAuth("dave", "secret")
+	b.authenticate(r)
+
+	want := []AuthResult{AuthMalformed, AuthFailure, AuthSuccess}
+	if len(logger.events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(logger.events), len(want))
+	}
+	for i, result := range want {
+		if logger.events[i] != result {
+			t.Errorf("event %d: got %s, want %s", i, logger.events[i], result)
+		}
+	}
+	if logger.users[2] != "dave" {
+		t.Errorf("expected successful event to record username, got %q", logger.users[2])
+	}
+}
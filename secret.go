@@ -0,0 +1,17 @@
+package middleware
+
+// SecretProvider looks up the stored secret for user within realm, following
+// the abbot/go-http-auth convention. It should return "" if the user is
+// unknown. The returned value is checked against the supplied password with
+// CheckSecret, so it may be a bcrypt, SHA, or MD5-crypt hash, or a plain-text
+// password.
+type SecretProvider func(user, realm string) string
+
+// MapProvider returns a SecretProvider backed by a static map of username to
+// secret, for applications that want to configure credentials
+// programmatically rather than via an htpasswd file.
+func MapProvider(secrets map[string]string) SecretProvider {
+	return func(user, realm string) string {
+		return secrets[user]
+	}
+}
@@ -0,0 +1,239 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FailureStore tracks failed authentication attempts per client IP, backing
+// AuthOptions.MaxFailuresPerIP/LockoutDuration/FailureWindow. Implementations
+// may share state across multiple instances (e.g. via Redis); NewMemoryFailureStore
+// returns the default in-memory implementation.
+type FailureStore interface {
+	// RecordFailure registers a failed attempt from ip and reports whether
+	// ip has now accumulated at least max failures within window.
+	RecordFailure(ip string, window time.Duration, max int) (thresholdReached bool)
+	// Locked reports whether ip is currently locked out, and if so for how
+	// much longer.
+	Locked(ip string) (locked bool, retryAfter time.Duration)
+	// Lock puts ip into lockout for the given duration.
+	Lock(ip string, duration time.Duration)
+	// ResetFailures clears all recorded failures and any active lockout for ip.
+	ResetFailures(ip string)
+}
+
+// trustedProxies is a pre-parsed AuthOptions.TrustedProxies list, built once
+// by parseTrustedProxies so that clientIP doesn't re-parse IPs/CIDRs on
+// every request.
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses each entry of list, which may be a bare IP or a
+// CIDR range, into a trustedProxies list. Bare IPs become single-address
+// (/32 or /128) networks. Unparseable entries are skipped.
+func parseTrustedProxies(list []string) trustedProxies {
+	proxies := make(trustedProxies, 0, len(list))
+	for _, entry := range list {
+		if strings.Contains(entry, "/") {
+			if _, cidr, err := net.ParseCIDR(entry); err == nil {
+				proxies = append(proxies, cidr)
+			}
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := net.IPv4len * 8
+			if ip.To4() == nil {
+				bits = net.IPv6len * 8
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		}
+	}
+	return proxies
+}
+
+func (t trustedProxies) contains(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range t {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP to throttle on for r. It is r's direct peer
+// address, unless that peer is a trusted proxy, in which case X-Forwarded-For
+// is walked from the right and the first entry that is itself not a trusted
+// proxy is used instead. The left-most X-Forwarded-For entry is client
+// controlled, so trusting it directly would let an attacker behind the proxy
+// evade throttling by sending a different value on every request.
+func clientIP(r *http.Request, proxies trustedProxies) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if len(proxies) == 0 || !proxies.contains(host) {
+		return host
+	}
+
+	xff := r.Header.Get("X-Forwarded-For")
+	if xff == "" {
+		return host
+	}
+
+	hops := strings.Split(xff, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop != "" && !proxies.contains(hop) {
+			return hop
+		}
+	}
+	return host
+}
+
+// memoryFailureStore is the default FailureStore, backed by a sharded
+// in-memory map with a background goroutine that periodically evicts idle
+// entries.
+type memoryFailureStore struct {
+	shards [failureStoreShardCount]*failureShard
+	stop   chan struct{}
+}
+
+const failureStoreShardCount = 32
+
+type failureShard struct {
+	mu      sync.Mutex
+	entries map[string]*ipFailures
+}
+
+type ipFailures struct {
+	count        int
+	windowStart  time.Time
+	lockedUntil  time.Time
+	lastActivity time.Time
+}
+
+// NewMemoryFailureStore returns an in-memory FailureStore. gcInterval controls
+// how often idle entries are evicted; retention is how long an entry with no
+// new failures and no active lockout is kept before eviction (it should be at
+// least as long as the largest FailureWindow/LockoutDuration in use). Pass
+// gcInterval <= 0 to disable the background sweep.
+func NewMemoryFailureStore(gcInterval, retention time.Duration) *memoryFailureStore {
+	s := &memoryFailureStore{stop: make(chan struct{})}
+	for i := range s.shards {
+		s.shards[i] = &failureShard{entries: make(map[string]*ipFailures)}
+	}
+	if gcInterval > 0 {
+		go s.gcLoop(gcInterval, retention)
+	}
+	return s
+}
+
+func (s *memoryFailureStore) shardFor(ip string) *failureShard {
+	var h uint32
+	for i := 0; i < len(ip); i++ {
+		h = h*31 + uint32(ip[i])
+	}
+	return s.shards[h%failureStoreShardCount]
+}
+
+func (s *memoryFailureStore) RecordFailure(ip string, window time.Duration, max int) bool {
+	shard := s.shardFor(ip)
+	now := time.Now()
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	f := shard.entries[ip]
+	if f == nil || now.Sub(f.windowStart) > window {
+		f = &ipFailures{windowStart: now}
+		shard.entries[ip] = f
+	}
+	f.count++
+	f.lastActivity = now
+
+	return f.count >= max
+}
+
+func (s *memoryFailureStore) Locked(ip string) (bool, time.Duration) {
+	shard := s.shardFor(ip)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	f := shard.entries[ip]
+	if f == nil || f.lockedUntil.IsZero() {
+		return false, 0
+	}
+
+	remaining := f.lockedUntil.Sub(time.Now())
+	if remaining <= 0 {
+		return false, 0
+	}
+	return true, remaining
+}
+
+func (s *memoryFailureStore) Lock(ip string, duration time.Duration) {
+	shard := s.shardFor(ip)
+	now := time.Now()
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	f := shard.entries[ip]
+	if f == nil {
+		f = &ipFailures{}
+		shard.entries[ip] = f
+	}
+	f.lockedUntil = now.Add(duration)
+	f.lastActivity = now
+}
+
+func (s *memoryFailureStore) ResetFailures(ip string) {
+	shard := s.shardFor(ip)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	delete(shard.entries, ip)
+}
+
+// Stop terminates the background GC goroutine. Safe to call at most once.
+func (s *memoryFailureStore) Stop() {
+	close(s.stop)
+}
+
+func (s *memoryFailureStore) gcLoop(interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.gc(retention)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *memoryFailureStore) gc(retention time.Duration) {
+	now := time.Now()
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+		for ip, f := range shard.entries {
+			if !f.lockedUntil.IsZero() && now.Before(f.lockedUntil) {
+				continue
+			}
+			if now.Sub(f.lastActivity) > retention {
+				delete(shard.entries, ip)
+			}
+		}
+		shard.mu.Unlock()
+	}
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryFailureStoreLockout(t *testing.T) {
+	store := NewMemoryFailureStore(0, time.Minute)
+
+	const ip = "203.0.113.7"
+	for i := 0; i < 2; i++ {
+		if store.RecordFailure(ip, time.Minute, 3) {
+			t.Fatalf("attempt %d should not have reached the threshold yet", i+1)
+		}
+	}
+	if !store.RecordFailure(ip, time.Minute, 3) {
+		t.Fatal("expected the 3rd failure to reach the threshold")
+	}
+
+	store.Lock(ip, 50*time.Millisecond)
+	locked, retryAfter := store.Locked(ip)
+	if !locked || retryAfter <= 0 {
+		t.Fatalf("expected ip to be locked out, got locked=%v retryAfter=%v", locked, retryAfter)
+	}
+
+	store.ResetFailures(ip)
+	if locked, _ := store.Locked(ip); locked {
+		t.Fatal("expected ResetFailures to clear the lockout")
+	}
+}
+
+func TestClientIPTrustedProxy(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:12345"
+	r.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.1")
+
+	if got := clientIP(r, nil); got != "10.0.0.1" {
+		t.Fatalf("with no trusted proxies, expected RemoteAddr host, got %q", got)
+	}
+	if got := clientIP(r, parseTrustedProxies([]string{"10.0.0.0/8"})); got != "203.0.113.9" {
+		t.Fatalf("with a trusted proxy, expected the right-most non-proxy X-Forwarded-For entry, got %q", got)
+	}
+}
+
+func TestClientIPIgnoresSpoofedLeftmostHop(t *testing.T) {
+	// A client behind our trusted proxy can set X-Forwarded-For itself. If
+	// we trusted the left-most entry, it could fake a different value on
+	// every request and dodge throttling entirely. The right-most entry
+	// that isn't itself a trusted proxy is the one our proxy actually saw.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:12345"
+	r.Header.Set("X-Forwarded-For", "attacker-supplied-garbage, 203.0.113.9, 10.0.0.1")
+
+	got := clientIP(r, parseTrustedProxies([]string{"10.0.0.0/8"}))
+	if got != "203.0.113.9" {
+		t.Fatalf("expected the proxy-observed hop 203.0.113.9, got %q", got)
+	}
+}
+
+func TestBasicAuthLockoutReturns429(t *testing.T) {
+	mw := BasicAuth(AuthOptions{
+		Realm:               "Restricted",
+		User:                "dave",
+		Password:            "secret",
+		UnauthorizedHandler: http.HandlerFunc(defaultUnauthorizedHandler),
+		MaxFailuresPerIP:    1,
+		FailureWindow:       time.Minute,
+		LockoutDuration:     time.Minute,
+	})
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "198.51.100.1:1234"
+	r.SetBasicAuth("dave", "wrong")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected first failed attempt to be unauthorized, got %d", w.Code)
+	}
+
+	r2 := httptest.NewRequest("GET", "/", nil)
+	r2.RemoteAddr = "198.51.100.1:1234"
+	r2.SetBasicAuth("dave", "secret")
+	w2 := httptest.NewRecorder()
+	handler.ServeHTTP(w2, r2)
+	if w2.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected locked-out IP to get 429 even with correct credentials, got %d", w2.Code)
+	}
+	if w2.Header().Get("Retry-After") == "" {
+		t.Fatal("expected a Retry-After header on the 429 response")
+	}
+}
+
+func TestBasicAuthWithStoreExposesDefaultStore(t *testing.T) {
+	mw, store := BasicAuthWithStore(AuthOptions{
+		Realm:               "Restricted",
+		User:                "dave",
+		Password:            "secret",
+		UnauthorizedHandler: http.HandlerFunc(defaultUnauthorizedHandler),
+		MaxFailuresPerIP:    1,
+		FailureWindow:       time.Minute,
+		LockoutDuration:     time.Minute,
+	})
+	if store == nil {
+		t.Fatal("expected a non-nil default FailureStore when MaxFailuresPerIP > 0")
+	}
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	const ip = "198.51.100.2"
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = ip + ":1234"
+	r.SetBasicAuth("dave", "wrong")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if locked, _ := store.Locked(ip); !locked {
+		t.Fatal("expected the failed attempt to lock the IP in the returned store")
+	}
+
+	store.ResetFailures(ip)
+	if locked, _ := store.Locked(ip); locked {
+		t.Fatal("expected ResetFailures on the returned store to unlock the IP")
+	}
+}
+
+func TestBasicAuthDefaultsZeroWindowAndLockout(t *testing.T) {
+	mw := BasicAuth(AuthOptions{
+		Realm:               "Restricted",
+		User:                "dave",
+		Password:            "secret",
+		UnauthorizedHandler: http.HandlerFunc(defaultUnauthorizedHandler),
+		MaxFailuresPerIP:    1,
+		// FailureWindow and LockoutDuration left at zero: without defaulting,
+		// a zero window would make RecordFailure never accumulate and the
+		// lockout would never trip.
+	})
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "198.51.100.3:1234"
+	r.SetBasicAuth("dave", "wrong")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	r2 := httptest.NewRequest("GET", "/", nil)
+	r2.RemoteAddr = "198.51.100.3:1234"
+	r2.SetBasicAuth("dave", "secret")
+	w2 := httptest.NewRecorder()
+	handler.ServeHTTP(w2, r2)
+	if w2.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected a zero FailureWindow/LockoutDuration to still trip the lockout, got %d", w2.Code)
+	}
+}